@@ -0,0 +1,44 @@
+package main
+
+import (
+	"fmt"
+	"net"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// Fingerprint returns the identifier ssh-chat uses to recognize a
+// client's key across reconnects and bans.
+func Fingerprint(key ssh.PublicKey) string {
+	return ssh.FingerprintLegacyMD5(key)
+}
+
+// MakeAuth builds an ssh.ServerConfig that accepts any public key, like
+// the rest of ssh-chat, but rejects a connection outright if its key,
+// source IP, or requested name is banned — before a shell is ever
+// allocated.
+func MakeAuth(server *Server, signer ssh.Signer) *ssh.ServerConfig {
+	config := &ssh.ServerConfig{
+		PublicKeyCallback: func(conn ssh.ConnMetadata, key ssh.PublicKey) (*ssh.Permissions, error) {
+			fingerprint := Fingerprint(key)
+
+			if ip, _, err := net.SplitHostPort(conn.RemoteAddr().String()); err == nil {
+				if entry := server.Bans.BanQuery(fmt.Sprintf("ip %s", ip)); entry != nil {
+					return nil, fmt.Errorf("banned: %s", entry.Reason)
+				}
+			}
+			if entry := server.Bans.BanQuery(fmt.Sprintf("key %s", fingerprint)); entry != nil {
+				return nil, fmt.Errorf("banned: %s", entry.Reason)
+			}
+			if entry := server.Bans.BanQuery(fmt.Sprintf("name %s", conn.User())); entry != nil {
+				return nil, fmt.Errorf("banned: %s", entry.Reason)
+			}
+
+			return &ssh.Permissions{
+				Extensions: map[string]string{"fingerprint": fingerprint},
+			}, nil
+		},
+	}
+	config.AddHostKey(signer)
+	return config
+}
@@ -0,0 +1,231 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// BanKind identifies what a BanEntry's Query is matched against.
+type BanKind int
+
+const (
+	BanKey BanKind = iota
+	BanIP
+	BanName
+)
+
+func (k BanKind) String() string {
+	switch k {
+	case BanKey:
+		return "key"
+	case BanIP:
+		return "ip"
+	case BanName:
+		return "name"
+	default:
+		return "unknown"
+	}
+}
+
+// BanEntry is a single persisted ban.
+type BanEntry struct {
+	Kind   BanKind
+	Query  string    // fingerprint, IP/CIDR, or nickname pattern
+	Expiry time.Time // zero means it never expires
+	Reason string
+	By     string // name of the op who set it
+}
+
+// Expired reports whether the ban's expiry has passed.
+func (e *BanEntry) Expired() bool {
+	return !e.Expiry.IsZero() && time.Now().After(e.Expiry)
+}
+
+// String renders a BanEntry for display to an op.
+func (e *BanEntry) String() string {
+	expiry := "never"
+	if !e.Expiry.IsZero() {
+		expiry = e.Expiry.Format(time.RFC3339)
+	}
+	reason := e.Reason
+	if reason == "" {
+		reason = "no reason given"
+	}
+	return fmt.Sprintf("[%s] %s (expires: %s, by: %s, reason: %s)", e.Kind, e.Query, expiry, e.By, reason)
+}
+
+// BanList is a persisted set of bans, checked by kind and query string
+// via BanQuery. It's safe for concurrent use.
+type BanList struct {
+	lock    sync.Mutex
+	path    string
+	entries []*BanEntry
+}
+
+// NewBanList creates a BanList that persists to path as JSON. An empty
+// path disables persistence.
+func NewBanList(path string) *BanList {
+	return &BanList{path: path}
+}
+
+// Load reads the banlist from disk, replacing any in-memory entries. A
+// missing file is not an error: it just means there are no bans yet.
+func (b *BanList) Load() error {
+	if b.path == "" {
+		return nil
+	}
+	data, err := os.ReadFile(b.path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	return json.Unmarshal(data, &b.entries)
+}
+
+func (b *BanList) save() error {
+	if b.path == "" {
+		return nil
+	}
+	data, err := json.MarshalIndent(b.entries, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(b.path, data, 0644)
+}
+
+// Add records a new ban and persists the list.
+func (b *BanList) Add(kind BanKind, query string, d time.Duration, reason string, by string) error {
+	var expiry time.Time
+	if d > 0 {
+		expiry = time.Now().Add(d)
+	}
+
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	b.entries = append(b.entries, &BanEntry{
+		Kind:   kind,
+		Query:  query,
+		Expiry: expiry,
+		Reason: reason,
+		By:     by,
+	})
+
+	return b.save()
+}
+
+// Remove drops the first ban whose query matches, returning whether one
+// was found.
+func (b *BanList) Remove(query string) bool {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	found := false
+	for i, e := range b.entries {
+		if e.Query == query {
+			b.entries = append(b.entries[:i], b.entries[i+1:]...)
+			found = true
+			break
+		}
+	}
+
+	if found {
+		b.save()
+	}
+	return found
+}
+
+// List returns all currently active (non-expired) bans.
+func (b *BanList) List() []*BanEntry {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	out := make([]*BanEntry, 0, len(b.entries))
+	for _, e := range b.entries {
+		if !e.Expired() {
+			out = append(out, e)
+		}
+	}
+	return out
+}
+
+// BanQuery checks a selector of the form "ip <addr>", "name <name>", or
+// "key <fingerprint>" against the banlist, and returns the matching
+// entry if any. Expired entries are pruned as they're encountered.
+func (b *BanList) BanQuery(selector string) *BanEntry {
+	parts := strings.SplitN(selector, " ", 2)
+	if len(parts) != 2 {
+		return nil
+	}
+	kind, value := parts[0], parts[1]
+
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	live := b.entries[:0]
+	var match *BanEntry
+	for _, e := range b.entries {
+		if e.Expired() {
+			continue
+		}
+		live = append(live, e)
+		if match != nil {
+			continue
+		}
+		switch kind {
+		case "key":
+			if e.Kind == BanKey && e.Query == value {
+				match = e
+			}
+		case "name":
+			if e.Kind == BanName && e.Query == value {
+				match = e
+			}
+		case "ip":
+			if e.Kind == BanIP && matchesIP(e.Query, value) {
+				match = e
+			}
+		}
+	}
+	b.entries = live
+	return match
+}
+
+func matchesIP(query, ip string) bool {
+	if query == ip {
+		return true
+	}
+	_, cidr, err := net.ParseCIDR(query)
+	if err != nil {
+		return false
+	}
+	addr := net.ParseIP(ip)
+	return addr != nil && cidr.Contains(addr)
+}
+
+// parseBanArgs splits the trailing "[duration] [reason]" portion of a
+// ban command. If the first field doesn't parse as a duration, the
+// whole string is treated as the reason and the ban is permanent.
+func parseBanArgs(rest string) (time.Duration, string) {
+	rest = strings.TrimSpace(rest)
+	if rest == "" {
+		return 0, ""
+	}
+	fields := strings.SplitN(rest, " ", 2)
+	if d, err := time.ParseDuration(fields[0]); err == nil {
+		reason := ""
+		if len(fields) == 2 {
+			reason = fields[1]
+		}
+		return d, reason
+	}
+	return 0, rest
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestBanListAddAndQuery(t *testing.T) {
+	b := NewBanList("")
+	if err := b.Add(BanName, "troll", 0, "spamming", "op"); err != nil {
+		t.Fatalf("Add: %v", err)
+	}
+
+	if entry := b.BanQuery("name troll"); entry == nil {
+		t.Fatal("expected a ban match for name troll")
+	}
+	if entry := b.BanQuery("name someoneelse"); entry != nil {
+		t.Fatalf("unexpected ban match: %v", entry)
+	}
+}
+
+func TestBanListExpiry(t *testing.T) {
+	b := NewBanList("")
+	if err := b.Add(BanKey, "abc123", time.Millisecond, "temp", "op"); err != nil {
+		t.Fatalf("Add: %v", err)
+	}
+	time.Sleep(5 * time.Millisecond)
+
+	if entry := b.BanQuery("key abc123"); entry != nil {
+		t.Fatalf("expected expired ban to no longer match, got %v", entry)
+	}
+	if len(b.List()) != 0 {
+		t.Fatalf("expected expired ban to be pruned, got %v", b.List())
+	}
+}
+
+func TestBanListRemove(t *testing.T) {
+	b := NewBanList("")
+	b.Add(BanIP, "10.0.0.1", 0, "", "op")
+
+	if !b.Remove("10.0.0.1") {
+		t.Fatal("expected Remove to find the entry")
+	}
+	if b.Remove("10.0.0.1") {
+		t.Fatal("expected second Remove to find nothing")
+	}
+	if entry := b.BanQuery("ip 10.0.0.1"); entry != nil {
+		t.Fatalf("expected removed ban to no longer match, got %v", entry)
+	}
+}
+
+func TestBanListPersistence(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "bans.json")
+
+	b := NewBanList(path)
+	if err := b.Add(BanName, "troll", 0, "spamming", "op"); err != nil {
+		t.Fatalf("Add: %v", err)
+	}
+
+	reloaded := NewBanList(path)
+	if err := reloaded.Load(); err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	if entry := reloaded.BanQuery("name troll"); entry == nil {
+		t.Fatal("expected persisted ban to reload")
+	}
+}
+
+func TestMatchesIP(t *testing.T) {
+	cases := []struct {
+		query, ip string
+		want      bool
+	}{
+		{"10.0.0.1", "10.0.0.1", true},
+		{"10.0.0.1", "10.0.0.2", false},
+		{"10.0.0.0/24", "10.0.0.42", true},
+		{"10.0.0.0/24", "10.0.1.1", false},
+		{"not-a-cidr", "10.0.0.1", false},
+	}
+	for _, c := range cases {
+		if got := matchesIP(c.query, c.ip); got != c.want {
+			t.Errorf("matchesIP(%q, %q) = %v, want %v", c.query, c.ip, got, c.want)
+		}
+	}
+}
@@ -3,6 +3,7 @@ package main
 import (
 	"fmt"
 	"strings"
+	"sync"
 	"time"
 
 	"golang.org/x/crypto/ssh"
@@ -11,15 +12,6 @@ import (
 
 const MSG_BUFFER int = 10
 
-const HELP_TEXT string = `-> Available commands:
-   /about
-   /exit
-   /help
-   /list
-   /nick $NAME
-   /whois $NAME
-`
-
 const ABOUT_TEXT string = `-> ssh-chat is made by @shazow.
 
    It is a custom ssh server built in Go to serve a chat experience
@@ -36,32 +28,92 @@ type Client struct {
 	Server        *Server
 	Conn          *ssh.ServerConn
 	Msg           chan string
-	Name          string
-	Color         string
 	Op            bool
+	Theme         *Theme
 	ready         chan struct{}
 	term          *terminal.Terminal
 	termWidth     int
 	termHeight    int
 	silencedUntil time.Time
+	limiter       *RateLimiter
+
+	// mu guards every field below, all of which can be written from
+	// one client's goroutine while read (or, for name/color, written)
+	// from another's: JoinRoom (also called by an op's /kick) moves a
+	// client between rooms from whichever goroutine calls it, the
+	// disconnect watcher and op commands read it from elsewhere, and an op's /color @$NAME
+	// force-recolors another client's name and color.
+	mu         sync.Mutex
+	name       string
+	color      string
+	room       *Room
+	lastPMFrom *Client
+	ignored    map[string]struct{} // fingerprints
 }
 
 func NewClient(server *Server, conn *ssh.ServerConn) *Client {
 	if autoCompleteFunc == nil {
 		autoCompleteFunc = createAutoCompleteFunc(server)
 	}
+	prefs := server.GetPrefs(conn.Permissions.Extensions["fingerprint"])
+
+	theme := defaultTheme
+	if t, ok := themes[prefs.Theme]; ok {
+		theme = t
+	}
+	color := RandomColor()
+	if prefs.Color != "" {
+		color = prefs.Color
+	}
+
 	return &Client{
-		Server: server,
-		Conn:   conn,
-		Name:   conn.User(),
-		Color:  RandomColor(),
-		Msg:    make(chan string, MSG_BUFFER),
-		ready:  make(chan struct{}, 1),
+		Server:  server,
+		Conn:    conn,
+		name:    conn.User(),
+		color:   color,
+		Theme:   theme,
+		Msg:     make(chan string, MSG_BUFFER),
+		ready:   make(chan struct{}, 1),
+		limiter: NewRateLimiter(server.RateMsgsPerSec, server.RateBytesPerSec, server.RateBurst),
+		ignored: map[string]struct{}{},
 	}
 }
 
+// Name returns c's current display name.
+func (c *Client) Name() string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.name
+}
+
 func (c *Client) ColoredName() string {
-	return ColorString(c.Color, c.Name)
+	c.mu.Lock()
+	name, color := c.name, c.color
+	c.mu.Unlock()
+	return c.Theme.ColorName(color, name)
+}
+
+// Color returns c's current name color.
+func (c *Client) Color() string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.color
+}
+
+// SetColor changes c's name color. It's safe to call from another
+// client's goroutine, e.g. an op force-recoloring someone with
+// /color @$NAME.
+func (c *Client) SetColor(color string) {
+	c.mu.Lock()
+	c.color = color
+	c.mu.Unlock()
+	c.Rename(c.Name()) // refresh the prompt's colored name
+}
+
+// savePrefs persists the client's current theme and color so they're
+// restored on their next connection.
+func (c *Client) savePrefs() {
+	c.Server.SetPrefs(c.Fingerprint(), ClientPrefs{Theme: c.Theme.Name, Color: c.Color()})
 }
 
 func (c *Client) Write(msg string) {
@@ -82,6 +134,60 @@ func (c *Client) Silence(d time.Duration) {
 	c.silencedUntil = time.Now().Add(d)
 }
 
+// IsIgnoring reports whether c has ignored fingerprint.
+func (c *Client) IsIgnoring(fingerprint string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	_, ok := c.ignored[fingerprint]
+	return ok
+}
+
+// Ignore suppresses messages and broadcasts from fingerprint.
+func (c *Client) Ignore(fingerprint string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.ignored[fingerprint] = struct{}{}
+}
+
+// Unignore reverses a prior Ignore.
+func (c *Client) Unignore(fingerprint string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.ignored, fingerprint)
+}
+
+// LastPMFrom returns the client who most recently sent c a PM, or nil if
+// none has yet.
+func (c *Client) LastPMFrom() *Client {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.lastPMFrom
+}
+
+// SetLastPMFrom records from as the sender of c's most recent PM, for
+// /reply to pick up.
+func (c *Client) SetLastPMFrom(from *Client) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.lastPMFrom = from
+}
+
+// GetRoom returns the room c is currently in.
+func (c *Client) GetRoom() *Room {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.room
+}
+
+// SetRoom updates which room c is currently in. It's called from
+// JoinRoom, which may run on either c's own goroutine (/join, /part,
+// /create) or another client's (an op's /kick).
+func (c *Client) SetRoom(r *Room) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.room = r
+}
+
 func (c *Client) Resize(width int, height int) error {
 	err := c.term.SetSize(width, height)
 	if err != nil {
@@ -92,9 +198,15 @@ func (c *Client) Resize(width int, height int) error {
 	return nil
 }
 
+// Rename changes c's display name. It's safe to call from another
+// client's goroutine (e.g. an op's /color @$NAME re-applying the same
+// name to refresh its color).
 func (c *Client) Rename(name string) {
-	c.Name = name
-	c.term.SetPrompt(fmt.Sprintf("[%s] ", c.ColoredName()))
+	c.mu.Lock()
+	c.name = name
+	color := c.color
+	c.mu.Unlock()
+	c.term.SetPrompt(fmt.Sprintf("[%s] ", c.Theme.ColorName(color, name)))
 }
 
 func (c *Client) Fingerprint() string {
@@ -106,6 +218,9 @@ func (c *Client) handleShell(channel ssh.Channel) {
 
 	// FIXME: This shouldn't live here, need to restructure the call chaining.
 	c.Server.Add(c)
+	if motd, err := c.Server.MOTD(); err == nil && motd != "" {
+		c.WriteLines(strings.Split(motd, "\n"))
+	}
 	go func() {
 		// Block until done, then remove.
 		c.Conn.Wait()
@@ -124,111 +239,44 @@ func (c *Client) handleShell(channel ssh.Channel) {
 			break
 		}
 
+		if entry := c.Server.CheckBanned(c); entry != nil {
+			c.Write(fmt.Sprintf("-> You're banned: %s", entry.Reason))
+			break
+		}
+
+		if !c.limiter.Allow(len(line)) {
+			c.Msg <- fmt.Sprintf("-> Rate limited, slow down.")
+			if d := c.limiter.Violate(); d > 0 {
+				c.Silence(d)
+				c.Write(fmt.Sprintf("-> Auto-silenced for %s for excessive flooding.", d))
+			}
+			continue
+		}
+
 		parts := strings.SplitN(line, " ", 3)
 		isCmd := strings.HasPrefix(parts[0], "/")
 
 		if isCmd {
-			// TODO: Factor this out.
-			switch parts[0] {
-			case "/test-colors": // Shh, this command is a secret!
-				c.Write(ColorString("32", "Lorem ipsum dolor sit amet,"))
-				c.Write("consectetur " + ColorString("31;1", "adipiscing") + " elit.")
-			case "/exit":
-				channel.Close()
-			case "/help":
-				c.WriteLines(strings.Split(HELP_TEXT, "\n"))
-			case "/about":
-				c.WriteLines(strings.Split(ABOUT_TEXT, "\n"))
-			case "/me":
-				me := strings.TrimLeft(line, "/me")
-				if me == "" {
-					me = " is at a loss for words."
-				}
-				msg := fmt.Sprintf("** %s%s", c.ColoredName(), me)
-				if c.IsSilenced() || len(msg) > 1000 {
-					c.Msg <- fmt.Sprintf("-> Message rejected.")
+			name, args := parts[0], parts[1:]
+			cmd, ok := commands.Find(name)
+			if !ok {
+				if suggestion := commands.Suggest(name); suggestion != "" {
+					c.Msg <- fmt.Sprintf("-> Invalid command: %s. Did you mean %s?", name, suggestion)
 				} else {
-					c.Server.Broadcast(msg, nil)
+					c.Msg <- fmt.Sprintf("-> Invalid command: %s", line)
 				}
-			case "/nick":
-				if len(parts) == 2 {
-					c.Server.Rename(c, parts[1])
-				} else {
-					c.Msg <- fmt.Sprintf("-> Missing $NAME from: /nick $NAME")
-				}
-			case "/whois":
-				if len(parts) == 2 {
-					client := c.Server.Who(parts[1])
-					if client != nil {
-						version := RE_STRIP_TEXT.ReplaceAllString(string(client.Conn.ClientVersion()), "")
-						if len(version) > 100 {
-							version = "Evil Jerk with a superlong string"
-						}
-						c.Msg <- fmt.Sprintf("-> %s is %s via %s", client.ColoredName(), client.Fingerprint(), version)
-					} else {
-						c.Msg <- fmt.Sprintf("-> No such name: %s", parts[1])
-					}
-				} else {
-					c.Msg <- fmt.Sprintf("-> Missing $NAME from: /whois $NAME")
-				}
-			case "/list":
-				names := c.Server.List(nil)
-				c.Msg <- fmt.Sprintf("-> %d connected: %s", len(names), strings.Join(names, ", "))
-			case "/ban":
-				if !c.Server.IsOp(c) {
-					c.Msg <- fmt.Sprintf("-> You're not an admin.")
-				} else if len(parts) != 2 {
-					c.Msg <- fmt.Sprintf("-> Missing $NAME from: /ban $NAME")
-				} else {
-					client := c.Server.Who(parts[1])
-					if client == nil {
-						c.Msg <- fmt.Sprintf("-> No such name: %s", parts[1])
-					} else {
-						fingerprint := client.Fingerprint()
-						client.Write(fmt.Sprintf("-> Banned by %s.", c.ColoredName()))
-						c.Server.Ban(fingerprint, nil)
-						client.Conn.Close()
-						c.Server.Broadcast(fmt.Sprintf("* %s was banned by %s", parts[1], c.ColoredName()), nil)
-					}
-				}
-			case "/op":
-				if !c.Server.IsOp(c) {
-					c.Msg <- fmt.Sprintf("-> You're not an admin.")
-				} else if len(parts) != 2 {
-					c.Msg <- fmt.Sprintf("-> Missing $NAME from: /op $NAME")
-				} else {
-					client := c.Server.Who(parts[1])
-					if client == nil {
-						c.Msg <- fmt.Sprintf("-> No such name: %s", parts[1])
-					} else {
-						fingerprint := client.Fingerprint()
-						client.Write(fmt.Sprintf("-> Made op by %s.", c.ColoredName()))
-						c.Server.Op(fingerprint)
-					}
-				}
-			case "/silence":
-				if !c.Server.IsOp(c) {
-					c.Msg <- fmt.Sprintf("-> You're not an admin.")
-				} else if len(parts) < 2 {
-					c.Msg <- fmt.Sprintf("-> Missing $NAME from: /silence $NAME")
-				} else {
-					duration := time.Duration(5) * time.Minute
-					if len(parts) >= 3 {
-						parsedDuration, err := time.ParseDuration(parts[2])
-						if err == nil {
-							duration = parsedDuration
-						}
-					}
-					client := c.Server.Who(parts[1])
-					if client == nil {
-						c.Msg <- fmt.Sprintf("-> No such name: %s", parts[1])
-					} else {
-						client.Silence(duration)
-						client.Write(fmt.Sprintf("-> Silenced for %s by %s.", duration, c.ColoredName()))
-					}
-				}
-			default:
-				c.Msg <- fmt.Sprintf("-> Invalid command: %s", line)
+				continue
+			}
+			if cmd.OpOnly && !c.Server.IsOp(c) {
+				c.Msg <- fmt.Sprintf("-> You're not an admin.")
+				continue
+			}
+			if len(args) < cmd.MinArgs {
+				c.Msg <- fmt.Sprintf("-> Usage: %s", cmd.Usage)
+				continue
+			}
+			if err := cmd.Handler(c, args); err != nil {
+				c.Msg <- fmt.Sprintf("-> %s", err)
 			}
 			continue
 		}
@@ -238,7 +286,7 @@ func (c *Client) handleShell(channel ssh.Channel) {
 			c.Msg <- fmt.Sprintf("-> Message rejected.")
 			continue
 		}
-		c.Server.Broadcast(msg, c)
+		c.GetRoom().Broadcast(msg, c, c)
 	}
 
 }
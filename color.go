@@ -0,0 +1,69 @@
+package main
+
+import (
+	"fmt"
+	"math/rand"
+	"strconv"
+	"strings"
+)
+
+// Colors is the palette of ANSI 256-color codes assigned to client
+// nicknames, chosen to stay readable on both light and dark terminals.
+var Colors = []string{
+	"1", "2", "3", "4", "5", "6",
+	"9", "10", "11", "12", "13", "14",
+}
+
+// ColorNames gives a few friendly names for the default palette, so
+// /color accepts e.g. "red" as well as the raw code "1".
+var ColorNames = map[string]string{
+	"red": "1", "green": "2", "yellow": "3", "blue": "4", "magenta": "5", "cyan": "6",
+	"brightred": "9", "brightgreen": "10", "brightyellow": "11",
+	"brightblue": "12", "brightmagenta": "13", "brightcyan": "14",
+}
+
+// ColorString wraps s in an ANSI escape sequence for code, which is
+// either a 256-color palette code (e.g. "32") or a "#RRGGBB" truecolor
+// value.
+func ColorString(code string, s string) string {
+	if r, g, b, ok := parseHexColor(code); ok {
+		return fmt.Sprintf("\033[38;2;%d;%d;%dm%s\033[0m", r, g, b, s)
+	}
+	return fmt.Sprintf("\033[38;5;%sm%s\033[0m", code, s)
+}
+
+// RandomColor picks a random color code from the default palette.
+func RandomColor() string {
+	return Colors[rand.Intn(len(Colors))]
+}
+
+// ValidateColor checks a user-supplied color against the named palette
+// or the "#RRGGBB" format, returning the canonical code to store.
+func ValidateColor(s string) (string, error) {
+	if strings.HasPrefix(s, "#") {
+		if _, _, _, ok := parseHexColor(s); !ok {
+			return "", fmt.Errorf("invalid color: %s", s)
+		}
+		return strings.ToUpper(s), nil
+	}
+	for _, code := range Colors {
+		if code == s {
+			return code, nil
+		}
+	}
+	if code, ok := ColorNames[strings.ToLower(s)]; ok {
+		return code, nil
+	}
+	return "", fmt.Errorf("unknown color: %s (try a name, palette code, or #RRGGBB)", s)
+}
+
+func parseHexColor(s string) (r, g, b int, ok bool) {
+	if len(s) != 7 || s[0] != '#' {
+		return 0, 0, 0, false
+	}
+	v, err := strconv.ParseUint(s[1:], 16, 32)
+	if err != nil {
+		return 0, 0, 0, false
+	}
+	return int(v >> 16 & 0xFF), int(v >> 8 & 0xFF), int(v & 0xFF), true
+}
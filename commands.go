@@ -0,0 +1,571 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Command is a single registered chat command. Handler receives the
+// words of the line after the command name: args[0] is the first word
+// (if any), args[1] is everything after it as one string (matching how
+// the shell loop splits a line into at most three parts).
+type Command struct {
+	Name    string
+	Aliases []string
+	Help    string
+	Usage   string
+	MinArgs int
+	OpOnly  bool
+	Handler func(c *Client, args []string) error
+}
+
+// Commands is a registry of Commands, looked up by name or alias.
+type Commands struct {
+	byName map[string]*Command
+}
+
+// NewCommands creates an empty command registry.
+func NewCommands() *Commands {
+	return &Commands{byName: map[string]*Command{}}
+}
+
+// Add registers cmd under its name and all of its aliases.
+func (cs *Commands) Add(cmd *Command) {
+	cs.byName[cmd.Name] = cmd
+	for _, alias := range cmd.Aliases {
+		cs.byName[alias] = cmd
+	}
+}
+
+// Find looks up a command by name or alias.
+func (cs *Commands) Find(name string) (*Command, bool) {
+	cmd, ok := cs.byName[name]
+	return cmd, ok
+}
+
+// Sorted returns each registered command once, sorted by canonical name.
+func (cs *Commands) Sorted() []*Command {
+	seen := map[string]bool{}
+	cmds := make([]*Command, 0, len(cs.byName))
+	for _, cmd := range cs.byName {
+		if seen[cmd.Name] {
+			continue
+		}
+		seen[cmd.Name] = true
+		cmds = append(cmds, cmd)
+	}
+	sort.Slice(cmds, func(i, j int) bool { return cmds[i].Name < cmds[j].Name })
+	return cmds
+}
+
+// Suggest returns the registered command name closest to the unknown
+// name typed, by Levenshtein distance, or "" if nothing is close enough
+// to be a plausible typo.
+func (cs *Commands) Suggest(name string) string {
+	best := ""
+	bestDist := -1
+	for _, cmd := range cs.Sorted() {
+		d := levenshtein(name, cmd.Name)
+		if bestDist == -1 || d < bestDist {
+			bestDist = d
+			best = cmd.Name
+		}
+	}
+	if bestDist >= 0 && bestDist <= 3 {
+		return best
+	}
+	return ""
+}
+
+func levenshtein(a, b string) int {
+	la, lb := len(a), len(b)
+	dp := make([][]int, la+1)
+	for i := range dp {
+		dp[i] = make([]int, lb+1)
+		dp[i][0] = i
+	}
+	for j := 0; j <= lb; j++ {
+		dp[0][j] = j
+	}
+	for i := 1; i <= la; i++ {
+		for j := 1; j <= lb; j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			dp[i][j] = minInt(dp[i-1][j]+1, dp[i][j-1]+1, dp[i-1][j-1]+cost)
+		}
+	}
+	return dp[la][lb]
+}
+
+func minInt(a, b, c int) int {
+	if b < a {
+		a = b
+	}
+	if c < a {
+		a = c
+	}
+	return a
+}
+
+// commands is the global command registry, populated in init below.
+var commands = NewCommands()
+
+func init() {
+	commands.Add(&Command{
+		Name: "/test-colors", Help: "Shh, this command is a secret!", Usage: "/test-colors",
+		Handler: func(c *Client, args []string) error {
+			c.Write(ColorString("32", "Lorem ipsum dolor sit amet,"))
+			c.Write("consectetur " + ColorString("31;1", "adipiscing") + " elit.")
+			return nil
+		},
+	})
+
+	commands.Add(&Command{
+		Name: "/exit", Help: "Disconnect from the server.", Usage: "/exit",
+		Handler: func(c *Client, args []string) error {
+			c.Conn.Close()
+			return nil
+		},
+	})
+
+	commands.Add(&Command{
+		Name: "/help", Aliases: []string{"/?"}, Help: "Show this help, or usage for a single command.", Usage: "/help [$CMD]",
+		Handler: cmdHelp,
+	})
+
+	commands.Add(&Command{
+		Name: "/about", Help: "About this server.", Usage: "/about",
+		Handler: func(c *Client, args []string) error {
+			c.WriteLines(strings.Split(ABOUT_TEXT, "\n"))
+			return nil
+		},
+	})
+
+	commands.Add(&Command{
+		Name: "/me", Help: "Broadcast an action to the room, e.g. /me waves.", Usage: "/me $ACTION",
+		Handler: func(c *Client, args []string) error {
+			action := strings.Join(args, " ")
+			if action == "" {
+				action = "is at a loss for words."
+			}
+			msg := fmt.Sprintf("** %s %s", c.ColoredName(), action)
+			if c.IsSilenced() || len(msg) > 1000 {
+				c.Msg <- fmt.Sprintf("-> Message rejected.")
+				return nil
+			}
+			c.GetRoom().Broadcast(msg, c, nil)
+			return nil
+		},
+	})
+
+	commands.Add(&Command{
+		Name: "/nick", Help: "Rename yourself.", Usage: "/nick $NAME", MinArgs: 1,
+		Handler: func(c *Client, args []string) error {
+			c.Server.Rename(c, args[0])
+			return nil
+		},
+	})
+
+	commands.Add(&Command{
+		Name: "/whois", Help: "Show a user's fingerprint and client.", Usage: "/whois $NAME", MinArgs: 1,
+		Handler: func(c *Client, args []string) error {
+			client := c.Server.Who(args[0])
+			if client == nil {
+				return fmt.Errorf("no such name: %s", args[0])
+			}
+			version := RE_STRIP_TEXT.ReplaceAllString(string(client.Conn.ClientVersion()), "")
+			if len(version) > 100 {
+				version = "Evil Jerk with a superlong string"
+			}
+			c.Msg <- fmt.Sprintf("-> %s is %s via %s", client.ColoredName(), client.Fingerprint(), version)
+			return nil
+		},
+	})
+
+	commands.Add(&Command{
+		Name: "/list", Help: "List the members of your current room.", Usage: "/list",
+		Handler: func(c *Client, args []string) error {
+			names := c.GetRoom().List()
+			c.Msg <- fmt.Sprintf("-> %d connected: %s", len(names), strings.Join(names, ", "))
+			return nil
+		},
+	})
+
+	commands.Add(&Command{
+		Name: "/rooms", Help: "List all rooms.", Usage: "/rooms",
+		Handler: func(c *Client, args []string) error {
+			rooms := c.Server.Rooms()
+			names := make([]string, 0, len(rooms))
+			for _, r := range rooms {
+				names = append(names, r.Name)
+			}
+			c.Msg <- fmt.Sprintf("-> %d rooms: %s", len(names), strings.Join(names, ", "))
+			return nil
+		},
+	})
+
+	commands.Add(&Command{
+		Name: "/join", Help: "Join a room.", Usage: "/join $ROOM", MinArgs: 1,
+		Handler: func(c *Client, args []string) error {
+			return c.Server.JoinRoom(c, args[0])
+		},
+	})
+
+	commands.Add(&Command{
+		Name: "/part", Help: "Return to the lobby.", Usage: "/part",
+		Handler: func(c *Client, args []string) error {
+			return c.Server.JoinRoom(c, DEFAULT_ROOM)
+		},
+	})
+
+	commands.Add(&Command{
+		Name: "/create", Help: "Create a room, optionally invite-only.", Usage: "/create $ROOM [--private]", MinArgs: 1,
+		Handler: func(c *Client, args []string) error {
+			name := args[0]
+			if name == "" {
+				return fmt.Errorf("missing $ROOM from: /create $ROOM [--private]")
+			}
+			private := len(args) > 1 && args[1] == "--private"
+			if err := c.Server.CreateRoom(c, name, private); err != nil {
+				return err
+			}
+			if err := c.Server.JoinRoom(c, name); err != nil {
+				return err
+			}
+			c.Msg <- fmt.Sprintf("-> Created room: %s", name)
+			return nil
+		},
+	})
+
+	commands.Add(&Command{
+		Name: "/invite", Help: "Invite a user into your current (private) room.", Usage: "/invite $NAME", MinArgs: 1,
+		Handler: func(c *Client, args []string) error {
+			room := c.GetRoom()
+			if !room.IsOp(c) {
+				return fmt.Errorf("you're not an op in this room")
+			}
+			target := c.Server.Who(args[0])
+			if target == nil {
+				return fmt.Errorf("no such name: %s", args[0])
+			}
+			room.Invite(target.Fingerprint())
+			target.Msg <- fmt.Sprintf("-> %s invited you to #%s", c.ColoredName(), room.Name)
+			c.Msg <- fmt.Sprintf("-> Invited %s to #%s", target.ColoredName(), room.Name)
+			return nil
+		},
+	})
+
+	commands.Add(&Command{
+		Name: "/kick", Help: "Kick a user out of your current room.", Usage: "/kick $NAME", MinArgs: 1,
+		Handler: func(c *Client, args []string) error {
+			room := c.GetRoom()
+			if !room.IsOp(c) {
+				return fmt.Errorf("you're not an op in this room")
+			}
+			target := c.Server.Who(args[0])
+			if target == nil || target.GetRoom() != room {
+				return fmt.Errorf("no such name: %s", args[0])
+			}
+			target.Msg <- fmt.Sprintf("-> You were kicked from #%s by %s.", room.Name, c.ColoredName())
+			c.Server.JoinRoom(target, DEFAULT_ROOM)
+			room.Broadcast(fmt.Sprintf("* %s was kicked by %s", target.ColoredName(), c.ColoredName()), nil, nil)
+			return nil
+		},
+	})
+
+	commands.Add(&Command{
+		Name: "/ban", OpOnly: true, Help: "Ban a name, with an optional duration and reason.", Usage: "/ban $NAME [duration] [reason]", MinArgs: 1,
+		Handler: func(c *Client, args []string) error {
+			rest := ""
+			if len(args) == 2 {
+				rest = args[1]
+			}
+			duration, reason := parseBanArgs(rest)
+			c.Server.Bans.Add(BanName, args[0], duration, reason, c.Name())
+
+			target := c.Server.Who(args[0])
+			if target != nil {
+				target.Write(fmt.Sprintf("-> Banned by %s.", c.ColoredName()))
+				target.Conn.Close()
+			}
+			c.Server.Broadcast(fmt.Sprintf("* %s was banned by %s", args[0], c.ColoredName()), nil)
+			return nil
+		},
+	})
+
+	commands.Add(&Command{
+		Name: "/banip", OpOnly: true, Help: "Ban a connected user's IP address.", Usage: "/banip $NAME [duration]", MinArgs: 1,
+		Handler: func(c *Client, args []string) error {
+			target := c.Server.Who(args[0])
+			if target == nil {
+				return fmt.Errorf("no such name: %s", args[0])
+			}
+			rest := ""
+			if len(args) == 2 {
+				rest = args[1]
+			}
+			duration, _ := parseBanArgs(rest)
+			ip, _, _ := net.SplitHostPort(target.Conn.RemoteAddr().String())
+			c.Server.Bans.Add(BanIP, ip, duration, "", c.Name())
+
+			target.Write(fmt.Sprintf("-> Banned by %s.", c.ColoredName()))
+			target.Conn.Close()
+			c.Server.Broadcast(fmt.Sprintf("* %s was banned by %s", args[0], c.ColoredName()), nil)
+			return nil
+		},
+	})
+
+	commands.Add(&Command{
+		Name: "/bankey", OpOnly: true, Help: "Ban a fingerprint directly.", Usage: "/bankey $FPRINT [duration]", MinArgs: 1,
+		Handler: func(c *Client, args []string) error {
+			rest := ""
+			if len(args) == 2 {
+				rest = args[1]
+			}
+			duration, _ := parseBanArgs(rest)
+			c.Server.Bans.Add(BanKey, args[0], duration, "", c.Name())
+			c.Msg <- fmt.Sprintf("-> Banned key %s.", args[0])
+			return nil
+		},
+	})
+
+	commands.Add(&Command{
+		Name: "/unban", OpOnly: true, Help: "Remove a ban by its query string.", Usage: "/unban $QUERY", MinArgs: 1,
+		Handler: func(c *Client, args []string) error {
+			if c.Server.Bans.Remove(args[0]) {
+				c.Msg <- fmt.Sprintf("-> Unbanned: %s", args[0])
+				return nil
+			}
+			return fmt.Errorf("no ban found for: %s", args[0])
+		},
+	})
+
+	commands.Add(&Command{
+		Name: "/banned", OpOnly: true, Help: "List active bans.", Usage: "/banned",
+		Handler: func(c *Client, args []string) error {
+			entries := c.Server.Bans.List()
+			if len(entries) == 0 {
+				c.Msg <- fmt.Sprintf("-> No active bans.")
+				return nil
+			}
+			for _, e := range entries {
+				c.Msg <- fmt.Sprintf("-> %s", e)
+			}
+			return nil
+		},
+	})
+
+	commands.Add(&Command{
+		Name: "/motd", Help: "Show the message of the day.", Usage: "/motd [reload|set $TEXT]",
+		Handler: func(c *Client, args []string) error {
+			if len(args) >= 1 && args[0] == "reload" {
+				if !c.Server.IsOp(c) {
+					return fmt.Errorf("you're not an admin")
+				}
+				c.Server.ReloadMOTD()
+				c.Msg <- fmt.Sprintf("-> MOTD reloaded.")
+				return nil
+			}
+			if len(args) >= 1 && args[0] == "set" {
+				if !c.Server.IsOp(c) {
+					return fmt.Errorf("you're not an admin")
+				}
+				text := ""
+				if len(args) == 2 {
+					text = args[1]
+				}
+				c.Server.SetMOTD(text)
+				c.Msg <- fmt.Sprintf("-> MOTD updated.")
+				return nil
+			}
+
+			motd, err := c.Server.MOTD()
+			if err != nil {
+				return fmt.Errorf("failed to load motd: %s", err)
+			}
+			if motd == "" {
+				c.Msg <- fmt.Sprintf("-> No MOTD set.")
+				return nil
+			}
+			c.WriteLines(strings.Split(motd, "\n"))
+			return nil
+		},
+	})
+
+	commands.Add(&Command{
+		Name: "/version", Help: "Show the server version.", Usage: "/version",
+		Handler: func(c *Client, args []string) error {
+			c.Msg <- fmt.Sprintf("-> %s", Version)
+			return nil
+		},
+	})
+
+	commands.Add(&Command{
+		Name: "/theme", Help: "Set your color theme, or list the available ones.", Usage: "/theme $NAME|list", MinArgs: 1,
+		Handler: func(c *Client, args []string) error {
+			if args[0] == "list" {
+				names := make([]string, 0, len(themes))
+				for name := range themes {
+					names = append(names, name)
+				}
+				sort.Strings(names)
+				c.Msg <- fmt.Sprintf("-> Available themes: %s", strings.Join(names, ", "))
+				return nil
+			}
+
+			theme, ok := themes[args[0]]
+			if !ok {
+				return fmt.Errorf("no such theme: %s", args[0])
+			}
+			c.Theme = theme
+			c.Rename(c.Name()) // refresh the prompt's colored name
+			c.savePrefs()
+			c.Msg <- fmt.Sprintf("-> Theme set to %s.", theme.Name)
+			return nil
+		},
+	})
+
+	commands.Add(&Command{
+		Name: "/color", Help: "Set your name color, or an op can force-recolor another user with @$NAME.", Usage: "/color $HEXORNAME | @$NAME $HEXORNAME", MinArgs: 1,
+		Handler: func(c *Client, args []string) error {
+			target := c
+			colorArg := args[0]
+
+			if strings.HasPrefix(args[0], "@") {
+				if !c.Server.IsOp(c) {
+					return fmt.Errorf("you're not an admin")
+				}
+				name := strings.TrimPrefix(args[0], "@")
+				if len(args) < 2 {
+					return fmt.Errorf("missing color from: /color @%s $COLOR", name)
+				}
+				who := c.Server.Who(name)
+				if who == nil {
+					return fmt.Errorf("no such name: %s", name)
+				}
+				target = who
+				colorArg = args[1]
+			}
+
+			color, err := ValidateColor(colorArg)
+			if err != nil {
+				return err
+			}
+			target.SetColor(color)
+			target.savePrefs()
+			target.Write(fmt.Sprintf("-> Your color is now %s.", target.ColoredName()))
+			return nil
+		},
+	})
+
+	commands.Add(&Command{
+		Name: "/msg", Help: "Send a private message to a user.", Usage: "/msg $NAME $TEXT", MinArgs: 2,
+		Handler: func(c *Client, args []string) error {
+			return c.Server.SendPrivate(c, args[0], args[1])
+		},
+	})
+
+	commands.Add(&Command{
+		Name: "/reply", Aliases: []string{"/r"}, Help: "Reply to the last user who sent you a PM.", Usage: "/reply $TEXT", MinArgs: 1,
+		Handler: func(c *Client, args []string) error {
+			from := c.LastPMFrom()
+			if from == nil {
+				return fmt.Errorf("no one to reply to")
+			}
+			return c.Server.SendPrivate(c, from.Name(), strings.Join(args, " "))
+		},
+	})
+
+	commands.Add(&Command{
+		Name: "/ignore", Help: "Stop seeing messages from a user.", Usage: "/ignore $NAME", MinArgs: 1,
+		Handler: func(c *Client, args []string) error {
+			who := c.Server.Who(args[0])
+			if who == nil {
+				return fmt.Errorf("no such name: %s", args[0])
+			}
+			c.Ignore(who.Fingerprint())
+			c.Msg <- fmt.Sprintf("-> Ignoring %s.", who.ColoredName())
+			return nil
+		},
+	})
+
+	commands.Add(&Command{
+		Name: "/unignore", Help: "Stop ignoring a user.", Usage: "/unignore $NAME", MinArgs: 1,
+		Handler: func(c *Client, args []string) error {
+			who := c.Server.Who(args[0])
+			if who == nil {
+				return fmt.Errorf("no such name: %s", args[0])
+			}
+			c.Unignore(who.Fingerprint())
+			c.Msg <- fmt.Sprintf("-> No longer ignoring %s.", who.ColoredName())
+			return nil
+		},
+	})
+
+	commands.Add(&Command{
+		Name: "/op", OpOnly: true, Help: "Make a user a server-wide op.", Usage: "/op $NAME", MinArgs: 1,
+		Handler: func(c *Client, args []string) error {
+			client := c.Server.Who(args[0])
+			if client == nil {
+				return fmt.Errorf("no such name: %s", args[0])
+			}
+			client.Write(fmt.Sprintf("-> Made op by %s.", c.ColoredName()))
+			c.Server.Op(client.Fingerprint())
+			return nil
+		},
+	})
+
+	commands.Add(&Command{
+		Name: "/silence", OpOnly: true, Help: "Silence a user for a duration (default 5m).", Usage: "/silence $NAME [duration]", MinArgs: 1,
+		Handler: func(c *Client, args []string) error {
+			duration := 5 * time.Minute
+			if len(args) == 2 {
+				if parsed, err := time.ParseDuration(args[1]); err == nil {
+					duration = parsed
+				}
+			}
+			client := c.Server.Who(args[0])
+			if client == nil {
+				return fmt.Errorf("no such name: %s", args[0])
+			}
+			client.Silence(duration)
+			client.Write(fmt.Sprintf("-> Silenced for %s by %s.", duration, c.ColoredName()))
+			return nil
+		},
+	})
+}
+
+func cmdHelp(c *Client, args []string) error {
+	if len(args) >= 1 {
+		cmd, ok := commands.Find(args[0])
+		if !ok {
+			return fmt.Errorf("no such command: %s", args[0])
+		}
+		c.Msg <- fmt.Sprintf("-> %s", cmd.Usage)
+		c.Msg <- fmt.Sprintf("   %s", cmd.Help)
+		return nil
+	}
+
+	c.Msg <- fmt.Sprintf("-> Available commands:")
+	for _, cmd := range commands.Sorted() {
+		if cmd.OpOnly || cmd.Name == "/test-colors" {
+			continue
+		}
+		c.Msg <- fmt.Sprintf("   %s", cmd.Usage)
+	}
+	if c.Server.IsOp(c) {
+		c.Msg <- fmt.Sprintf("-> Op commands:")
+		for _, cmd := range commands.Sorted() {
+			if !cmd.OpOnly {
+				continue
+			}
+			c.Msg <- fmt.Sprintf("   %s", cmd.Usage)
+		}
+	}
+	return nil
+}
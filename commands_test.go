@@ -0,0 +1,48 @@
+package main
+
+import "testing"
+
+func TestLevenshtein(t *testing.T) {
+	cases := []struct {
+		a, b string
+		want int
+	}{
+		{"", "", 0},
+		{"abc", "abc", 0},
+		{"abc", "", 3},
+		{"/nic", "/nick", 1},
+		{"/kik", "/kick", 1},
+		{"kitten", "sitting", 3},
+	}
+	for _, c := range cases {
+		if got := levenshtein(c.a, c.b); got != c.want {
+			t.Errorf("levenshtein(%q, %q) = %d, want %d", c.a, c.b, got, c.want)
+		}
+	}
+}
+
+func TestCommandsSuggest(t *testing.T) {
+	cs := NewCommands()
+	cs.Add(&Command{Name: "/nick"})
+	cs.Add(&Command{Name: "/kick"})
+
+	if got := cs.Suggest("/nic"); got != "/nick" {
+		t.Errorf("Suggest(/nic) = %q, want /nick", got)
+	}
+	if got := cs.Suggest("/xyzzyplugh"); got != "" {
+		t.Errorf("Suggest(/xyzzyplugh) = %q, want no suggestion", got)
+	}
+}
+
+func TestCommandsFindByAlias(t *testing.T) {
+	cs := NewCommands()
+	cmd := &Command{Name: "/reply", Aliases: []string{"/r"}}
+	cs.Add(cmd)
+
+	if got, ok := cs.Find("/r"); !ok || got != cmd {
+		t.Errorf("Find(/r) = %v, %v, want %v, true", got, ok, cmd)
+	}
+	if _, ok := cs.Find("/nope"); ok {
+		t.Error("Find(/nope) should not match anything")
+	}
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"flag"
+	"io/ioutil"
+	"net"
+
+	"golang.org/x/crypto/ssh"
+)
+
+var (
+	flagPort     = flag.String("port", "2022", "Port to listen on.")
+	flagIdentity = flag.String("identity", "", "Path to the private key to use as the host key.")
+	flagBanlist  = flag.String("banlist", "", "Path to persist the banlist as JSON. Empty disables persistence.")
+	flagMOTD     = flag.String("motd", "", "Path to a message-of-the-day file shown to new clients. Empty disables it.")
+
+	flagRateMsgs  = flag.Float64("rate-msgs", DefaultRateMsgsPerSec, "Max messages/sec a client can send before being rate limited.")
+	flagRateBytes = flag.Float64("rate-bytes", DefaultRateBytesPerSec, "Max bytes/sec a client can send before being rate limited.")
+	flagRateBurst = flag.Float64("rate-burst", DefaultRateBurst, "Burst allowance, in messages, for rate limiting.")
+)
+
+func main() {
+	flag.Parse()
+
+	keyBytes, err := ioutil.ReadFile(*flagIdentity)
+	if err != nil {
+		logger.Errorf("Failed to read identity: %v", err)
+		return
+	}
+	signer, err := ssh.ParsePrivateKey(keyBytes)
+	if err != nil {
+		logger.Errorf("Failed to parse identity: %v", err)
+		return
+	}
+
+	server := NewServer(*flagBanlist, *flagMOTD)
+	if err := server.Bans.Load(); err != nil {
+		logger.Errorf("Failed to load banlist: %v", err)
+	}
+	server.RateMsgsPerSec = *flagRateMsgs
+	server.RateBytesPerSec = *flagRateBytes
+	server.RateBurst = *flagRateBurst
+
+	config := MakeAuth(server, signer)
+
+	listener, err := net.Listen("tcp", "0.0.0.0:"+*flagPort)
+	if err != nil {
+		logger.Errorf("Failed to listen on %s: %v", *flagPort, err)
+		return
+	}
+	logger.Errorf("Listening on %s", *flagPort)
+
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			logger.Errorf("Failed to accept connection: %v", err)
+			continue
+		}
+		go handleConn(server, config, conn)
+	}
+}
+
+func handleConn(server *Server, config *ssh.ServerConfig, conn net.Conn) {
+	sshConn, channels, requests, err := ssh.NewServerConn(conn, config)
+	if err != nil {
+		logger.Errorf("Failed to handshake: %v", err)
+		return
+	}
+	go ssh.DiscardRequests(requests)
+
+	client := NewClient(server, sshConn)
+	client.handleChannels(channels)
+}
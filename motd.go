@@ -0,0 +1,26 @@
+package main
+
+import "os"
+
+// Version is the server version string, baked in at build time via
+// `-ldflags "-X main.Version=..."`. It stays "dev" for local builds.
+var Version = "dev"
+
+// fileMOTD returns a GetMOTD hook that reads the MOTD fresh from path on
+// every call, so /motd reload just has to drop any in-memory override
+// for the file's contents to take effect again.
+func fileMOTD(path string) func() (string, error) {
+	return func() (string, error) {
+		if path == "" {
+			return "", nil
+		}
+		data, err := os.ReadFile(path)
+		if os.IsNotExist(err) {
+			return "", nil
+		}
+		if err != nil {
+			return "", err
+		}
+		return string(data), nil
+	}
+}
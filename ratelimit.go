@@ -0,0 +1,101 @@
+package main
+
+import (
+	"math"
+	"sync"
+	"time"
+)
+
+// rateLimitViolationThreshold is how many dropped lines within
+// rateLimitViolationWindow trigger an escalating auto-silence.
+const (
+	rateLimitViolationThreshold = 5
+	rateLimitViolationWindow    = 10 * time.Second
+)
+
+// silenceEscalation is how long a client gets auto-silenced each time
+// they keep flooding after being rate limited: 30s, then 5m, then 1h,
+// staying at 1h for any further offense.
+var silenceEscalation = []time.Duration{30 * time.Second, 5 * time.Minute, time.Hour}
+
+// RateLimiter is a token-bucket limiter tracking both a message rate and
+// a byte rate for a single client's input.
+type RateLimiter struct {
+	lock sync.Mutex
+
+	msgRate  float64 // messages/sec
+	byteRate float64 // bytes/sec
+	burst    float64 // message burst allowance
+
+	msgTokens  float64
+	byteTokens float64
+	last       time.Time
+
+	violations  int
+	windowStart time.Time
+	stage       int
+}
+
+// NewRateLimiter creates a limiter allowing msgsPerSec messages and
+// bytesPerSec bytes per second on average, with up to burst messages
+// allowed instantaneously.
+func NewRateLimiter(msgsPerSec, bytesPerSec, burst float64) *RateLimiter {
+	now := time.Now()
+	return &RateLimiter{
+		msgRate:    msgsPerSec,
+		byteRate:   bytesPerSec,
+		burst:      burst,
+		msgTokens:  burst,
+		byteTokens: bytesPerSec,
+		last:       now,
+	}
+}
+
+// Allow reports whether a line of the given size is within the current
+// rate budget, consuming tokens from both buckets if so.
+func (r *RateLimiter) Allow(size int) bool {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	now := time.Now()
+	elapsed := now.Sub(r.last).Seconds()
+	r.last = now
+
+	r.msgTokens = math.Min(r.burst, r.msgTokens+elapsed*r.msgRate)
+	r.byteTokens = math.Min(r.byteRate, r.byteTokens+elapsed*r.byteRate)
+
+	if r.msgTokens < 1 || r.byteTokens < float64(size) {
+		return false
+	}
+	r.msgTokens--
+	r.byteTokens -= float64(size)
+	return true
+}
+
+// Violate records a dropped line and returns how long the client should
+// be auto-silenced for, or 0 if they haven't hit the violation
+// threshold within the current window yet.
+func (r *RateLimiter) Violate() time.Duration {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	now := time.Now()
+	if now.Sub(r.windowStart) > rateLimitViolationWindow {
+		r.windowStart = now
+		r.violations = 0
+	}
+	r.violations++
+
+	if r.violations < rateLimitViolationThreshold {
+		return 0
+	}
+
+	r.violations = 0
+	r.windowStart = now
+
+	d := silenceEscalation[r.stage]
+	if r.stage < len(silenceEscalation)-1 {
+		r.stage++
+	}
+	return d
+}
@@ -0,0 +1,64 @@
+package main
+
+import "testing"
+
+func TestRateLimiterAllowsWithinBurst(t *testing.T) {
+	r := NewRateLimiter(10, 4096, 5)
+	for i := 0; i < 5; i++ {
+		if !r.Allow(10) {
+			t.Fatalf("expected message %d to be allowed within burst", i)
+		}
+	}
+	if r.Allow(10) {
+		t.Fatal("expected message beyond burst to be rate limited")
+	}
+}
+
+func TestRateLimiterByteBudget(t *testing.T) {
+	r := NewRateLimiter(100, 50, 100)
+	if !r.Allow(40) {
+		t.Fatal("expected a 40-byte line within a 50-byte budget to be allowed")
+	}
+	if r.Allow(40) {
+		t.Fatal("expected a second 40-byte line to exceed the byte budget")
+	}
+}
+
+func TestRateLimiterViolateEscalates(t *testing.T) {
+	r := NewRateLimiter(10, 4096, 20)
+
+	for i := 0; i < rateLimitViolationThreshold-1; i++ {
+		if d := r.Violate(); d != 0 {
+			t.Fatalf("violation %d: expected no silence yet, got %s", i, d)
+		}
+	}
+
+	d := r.Violate()
+	if d != silenceEscalation[0] {
+		t.Fatalf("expected first escalation stage %s, got %s", silenceEscalation[0], d)
+	}
+
+	for i := 0; i < rateLimitViolationThreshold-1; i++ {
+		r.Violate()
+	}
+	d = r.Violate()
+	if d != silenceEscalation[1] {
+		t.Fatalf("expected second escalation stage %s, got %s", silenceEscalation[1], d)
+	}
+}
+
+func TestRateLimiterViolateCapsAtLastStage(t *testing.T) {
+	r := NewRateLimiter(10, 4096, 20)
+
+	var last float64
+	for stage := 0; stage < len(silenceEscalation)+2; stage++ {
+		var d float64
+		for i := 0; i < rateLimitViolationThreshold; i++ {
+			d = float64(r.Violate())
+		}
+		last = d
+	}
+	if last != float64(silenceEscalation[len(silenceEscalation)-1]) {
+		t.Fatalf("expected escalation to cap at %s, got stage returning %v", silenceEscalation[len(silenceEscalation)-1], last)
+	}
+}
@@ -0,0 +1,96 @@
+package main
+
+import "sync"
+
+// Room is a named chat channel. Clients belong to exactly one room at a
+// time, and messages broadcast within a room only reach its members.
+type Room struct {
+	Name    string
+	Private bool
+	Owner   string // fingerprint of the client who created it, if any
+
+	lock    sync.Mutex
+	members map[*Client]struct{}
+	invited map[string]struct{} // fingerprints invited to a private room
+}
+
+// NewRoom creates an empty room. owner may be "" for server-created
+// rooms like the default lobby.
+func NewRoom(name string, owner string, private bool) *Room {
+	return &Room{
+		Name:    name,
+		Private: private,
+		Owner:   owner,
+		members: map[*Client]struct{}{},
+		invited: map[string]struct{}{},
+	}
+}
+
+// Add registers c as a member of the room.
+func (r *Room) Add(c *Client) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.members[c] = struct{}{}
+}
+
+// Remove drops c from the room's membership.
+func (r *Room) Remove(c *Client) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	delete(r.members, c)
+}
+
+// Invite whitelists fingerprint to join a private room.
+func (r *Room) Invite(fingerprint string) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.invited[fingerprint] = struct{}{}
+}
+
+// IsInvited reports whether fingerprint has a standing invite.
+func (r *Room) IsInvited(fingerprint string) bool {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	_, ok := r.invited[fingerprint]
+	return ok
+}
+
+// IsOp reports whether c can moderate this room: either a server-wide
+// op, or the client who created it.
+func (r *Room) IsOp(c *Client) bool {
+	return c.Server.IsOp(c) || (r.Owner != "" && c.Fingerprint() == r.Owner)
+}
+
+// List returns the names of the room's current members.
+func (r *Room) List() []string {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	names := make([]string, 0, len(r.members))
+	for c := range r.members {
+		names = append(names, c.Name())
+	}
+	return names
+}
+
+// Broadcast sends msg to every member of the room, skipping except if
+// it's not nil. If sender is not nil, members ignoring sender are
+// skipped too; pass nil for system messages that aren't attributable
+// to a single user and shouldn't be suppressed by /ignore.
+func (r *Room) Broadcast(msg string, sender *Client, except *Client) {
+	r.lock.Lock()
+	members := make([]*Client, 0, len(r.members))
+	for c := range r.members {
+		members = append(members, c)
+	}
+	r.lock.Unlock()
+
+	for _, c := range members {
+		if c == except {
+			continue
+		}
+		if sender != nil && c.IsIgnoring(sender.Fingerprint()) {
+			continue
+		}
+		c.Msg <- msg
+	}
+}
@@ -0,0 +1,301 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+)
+
+// DEFAULT_ROOM is the name of the room every client lands in on connect.
+const DEFAULT_ROOM string = "lobby"
+
+// Default per-client rate limits, overridable on a Server before any
+// clients connect (see the --rate-* flags in main.go).
+const (
+	DefaultRateMsgsPerSec  = 10.0
+	DefaultRateBytesPerSec = 4096.0
+	DefaultRateBurst       = 20.0
+)
+
+// Server tracks connected clients, named rooms, and moderation state for
+// a single ssh-chat instance.
+type Server struct {
+	lock sync.Mutex
+
+	clients map[string]*Client // by name
+	ops     map[string]bool    // by fingerprint
+
+	rooms map[string]*Room
+
+	Bans *BanList
+
+	// GetMOTD loads the message of the day, e.g. from disk. It's called
+	// fresh each time the MOTD is needed, so ops can just drop the
+	// motdOverride below to have it take effect again.
+	GetMOTD      func() (string, error)
+	motdOverride string
+
+	// Per-client rate limiting, read by NewClient when a connection is
+	// accepted. Safe to override right after NewServer, before Accept
+	// starts handing off connections.
+	RateMsgsPerSec  float64
+	RateBytesPerSec float64
+	RateBurst       float64
+
+	prefs map[string]ClientPrefs // by fingerprint
+}
+
+// ClientPrefs are a client's saved display preferences, kept around
+// across reconnects by fingerprint.
+type ClientPrefs struct {
+	Theme string
+	Color string
+}
+
+// NewServer creates a Server with the default lobby room ready to join.
+// banPath is where the banlist is persisted and motdPath is where the
+// MOTD is read from; either may be empty to disable the feature.
+func NewServer(banPath string, motdPath string) *Server {
+	s := &Server{
+		clients: map[string]*Client{},
+		ops:     map[string]bool{},
+		rooms:   map[string]*Room{},
+		Bans:    NewBanList(banPath),
+		GetMOTD: fileMOTD(motdPath),
+
+		RateMsgsPerSec:  DefaultRateMsgsPerSec,
+		RateBytesPerSec: DefaultRateBytesPerSec,
+		RateBurst:       DefaultRateBurst,
+
+		prefs: map[string]ClientPrefs{},
+	}
+	s.rooms[DEFAULT_ROOM] = NewRoom(DEFAULT_ROOM, "", false)
+	return s
+}
+
+// MOTD returns the message of the day: an in-memory override if an op
+// has set one, otherwise whatever GetMOTD currently returns.
+func (s *Server) MOTD() (string, error) {
+	s.lock.Lock()
+	override := s.motdOverride
+	s.lock.Unlock()
+	if override != "" {
+		return override, nil
+	}
+	if s.GetMOTD == nil {
+		return "", nil
+	}
+	return s.GetMOTD()
+}
+
+// SetMOTD installs an in-memory MOTD override, taking priority over
+// GetMOTD until the next reload.
+func (s *Server) SetMOTD(text string) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.motdOverride = text
+}
+
+// ReloadMOTD clears any in-memory override so GetMOTD's result (e.g.
+// freshly re-read from disk) takes effect again.
+func (s *Server) ReloadMOTD() {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.motdOverride = ""
+}
+
+// Add registers a newly connected client and drops them into the lobby.
+func (s *Server) Add(c *Client) {
+	s.lock.Lock()
+	s.clients[c.Name()] = c
+	s.lock.Unlock()
+
+	s.JoinRoom(c, DEFAULT_ROOM)
+}
+
+// Remove unregisters a client on disconnect and clears them out of
+// whichever room they were in.
+func (s *Server) Remove(c *Client) {
+	s.lock.Lock()
+	delete(s.clients, c.Name())
+	s.lock.Unlock()
+
+	if room := c.GetRoom(); room != nil {
+		room.Remove(c)
+		room.Broadcast(fmt.Sprintf("* %s left.", c.ColoredName()), nil, c)
+	}
+}
+
+// Broadcast sends msg to every connected client, regardless of room,
+// skipping except if it's not nil. It's meant for server-wide
+// announcements; chat messages should go through a Room instead.
+func (s *Server) Broadcast(msg string, except *Client) {
+	s.lock.Lock()
+	clients := make([]*Client, 0, len(s.clients))
+	for _, c := range s.clients {
+		clients = append(clients, c)
+	}
+	s.lock.Unlock()
+
+	for _, c := range clients {
+		if c == except {
+			continue
+		}
+		c.Msg <- msg
+	}
+}
+
+// Who looks up a connected client by name.
+func (s *Server) Who(name string) *Client {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.clients[name]
+}
+
+// List returns the names of connected clients, optionally filtered to
+// those with the given prefix.
+func (s *Server) List(prefix *string) []string {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	names := make([]string, 0, len(s.clients))
+	for name := range s.clients {
+		if prefix != nil && !strings.HasPrefix(name, *prefix) {
+			continue
+		}
+		names = append(names, name)
+	}
+	return names
+}
+
+// Rename moves a client to a new name in the registry.
+func (s *Server) Rename(c *Client, newName string) {
+	s.lock.Lock()
+	delete(s.clients, c.Name())
+	s.clients[newName] = c
+	s.lock.Unlock()
+	c.Rename(newName)
+}
+
+// IsOp reports whether c is a server-wide operator.
+func (s *Server) IsOp(c *Client) bool {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.ops[c.Fingerprint()]
+}
+
+// Op promotes the holder of fingerprint to server-wide operator.
+func (s *Server) Op(fingerprint string) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.ops[fingerprint] = true
+}
+
+// GetPrefs returns the saved display preferences for fingerprint, or the
+// zero value if it has none yet.
+func (s *Server) GetPrefs(fingerprint string) ClientPrefs {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.prefs[fingerprint]
+}
+
+// SetPrefs saves fingerprint's display preferences for future
+// reconnects.
+func (s *Server) SetPrefs(fingerprint string, prefs ClientPrefs) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.prefs[fingerprint] = prefs
+}
+
+// SendPrivate delivers a direct message from one client to another by
+// name. It respects the sender's silence, the recipient's ignore list,
+// and the same length cap as a broadcast message; it never touches any
+// room and so never appears in the public chat log.
+func (s *Server) SendPrivate(from *Client, toName string, text string) error {
+	to := s.Who(toName)
+	if to == nil {
+		return fmt.Errorf("no such name: %s", toName)
+	}
+	if from.IsSilenced() || len(text) > 1000 {
+		return fmt.Errorf("message rejected")
+	}
+	if to.IsIgnoring(from.Fingerprint()) {
+		// Don't let the sender learn they've been ignored.
+		return nil
+	}
+
+	to.SetLastPMFrom(from)
+	to.Msg <- fmt.Sprintf("[PM from %s] %s", from.ColoredName(), text)
+	from.Msg <- fmt.Sprintf("[PM to %s] %s", to.ColoredName(), text)
+	return nil
+}
+
+// Rooms returns every room currently known to the server.
+func (s *Server) Rooms() []*Room {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	rooms := make([]*Room, 0, len(s.rooms))
+	for _, r := range s.rooms {
+		rooms = append(rooms, r)
+	}
+	return rooms
+}
+
+// CreateRoom registers a new room owned by c. Ownership makes c an op of
+// the room it created.
+func (s *Server) CreateRoom(c *Client, name string, private bool) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if _, ok := s.rooms[name]; ok {
+		return fmt.Errorf("room already exists: %s", name)
+	}
+	s.rooms[name] = NewRoom(name, c.Fingerprint(), private)
+	return nil
+}
+
+// JoinRoom moves c into the named room, leaving whichever room it was
+// previously in. Private rooms require c to be invited or an op first.
+func (s *Server) JoinRoom(c *Client, name string) error {
+	s.lock.Lock()
+	room, ok := s.rooms[name]
+	s.lock.Unlock()
+	if !ok {
+		return fmt.Errorf("no such room: %s", name)
+	}
+	if room.Private && !room.IsOp(c) && !room.IsInvited(c.Fingerprint()) {
+		return fmt.Errorf("room is invite-only: %s", name)
+	}
+
+	if c.GetRoom() == room {
+		return nil
+	}
+
+	if old := c.GetRoom(); old != nil {
+		old.Remove(c)
+		old.Broadcast(fmt.Sprintf("* %s left.", c.ColoredName()), nil, c)
+	}
+	c.SetRoom(room)
+	room.Add(c)
+	room.Broadcast(fmt.Sprintf("* %s joined.", c.ColoredName()), nil, c)
+	return nil
+}
+
+// CheckBanned re-checks c's key, IP, and current name against the
+// banlist, returning the matching entry if any. PublicKeyCallback only
+// catches bans at connection time, so handleShell calls this on every
+// line to catch bans (or a /nick into a banned name) applied mid-session.
+func (s *Server) CheckBanned(c *Client) *BanEntry {
+	if ip, _, err := net.SplitHostPort(c.Conn.RemoteAddr().String()); err == nil {
+		if entry := s.Bans.BanQuery(fmt.Sprintf("ip %s", ip)); entry != nil {
+			return entry
+		}
+	}
+	if entry := s.Bans.BanQuery(fmt.Sprintf("key %s", c.Fingerprint())); entry != nil {
+		return entry
+	}
+	if entry := s.Bans.BanQuery(fmt.Sprintf("name %s", c.Name())); entry != nil {
+		return entry
+	}
+	return nil
+}
@@ -0,0 +1,51 @@
+package main
+
+import "strings"
+
+// Theme controls how a client's name is rendered. ColorName wraps name
+// in whatever escape sequence color (a palette code or "#RRGGBB") means
+// under this theme.
+type Theme struct {
+	Name      string
+	ColorName func(color string, name string) string
+}
+
+// themes is the set of themes selectable via /theme.
+var themes = map[string]*Theme{
+	"mono": {
+		Name: "mono",
+		ColorName: func(color string, name string) string {
+			return name
+		},
+	},
+	"colors": {
+		Name:      "colors",
+		ColorName: ColorString,
+	},
+	"solarized": {
+		Name: "solarized",
+		ColorName: func(color string, name string) string {
+			if strings.HasPrefix(color, "#") {
+				return ColorString(color, name)
+			}
+			return ColorString(solarizedCode(color), name)
+		},
+	},
+}
+
+// defaultTheme is used for clients with no saved preference.
+var defaultTheme = themes["colors"]
+
+// solarizedPalette remaps the default 256-color palette codes onto their
+// nearest solarized accent colors.
+var solarizedPalette = map[string]string{
+	"1": "160", "2": "64", "3": "136", "4": "33", "5": "125", "6": "37",
+	"9": "166", "10": "64", "11": "136", "12": "33", "13": "125", "14": "37",
+}
+
+func solarizedCode(code string) string {
+	if sc, ok := solarizedPalette[code]; ok {
+		return sc
+	}
+	return code
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"log"
+	"regexp"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// RE_STRIP_TEXT strips anything but letters, digits, underscores,
+// hyphens, dots and spaces out of client version strings before they're
+// shown to other users.
+var RE_STRIP_TEXT = regexp.MustCompile(`[^a-zA-Z0-9_\-\. ]`)
+
+// logging is kept minimal on purpose: this is a small server and
+// anything fancier belongs in a real logging package if it grows.
+type logging struct{}
+
+func (logging) Errorf(format string, args ...interface{}) {
+	log.Printf("[error] "+format, args...)
+}
+
+var logger = logging{}
+
+type ptyRequestMsg struct {
+	Term     string
+	Columns  uint32
+	Rows     uint32
+	Width    uint32
+	Height   uint32
+	Modelist string
+}
+
+// parsePtyRequest decodes an SSH pty-req payload into a terminal size.
+func parsePtyRequest(payload []byte) (width int, height int, ok bool) {
+	var msg ptyRequestMsg
+	if err := ssh.Unmarshal(payload, &msg); err != nil {
+		return 0, 0, false
+	}
+	return int(msg.Columns), int(msg.Rows), true
+}
+
+type winchMsg struct {
+	Columns uint32
+	Rows    uint32
+	Width   uint32
+	Height  uint32
+}
+
+// parseWinchRequest decodes an SSH window-change payload into a new
+// terminal size.
+func parseWinchRequest(payload []byte) (width int, height int, ok bool) {
+	var msg winchMsg
+	if err := ssh.Unmarshal(payload, &msg); err != nil {
+		return 0, 0, false
+	}
+	return int(msg.Columns), int(msg.Rows), true
+}